@@ -2,11 +2,15 @@
 
 import argparse
 import difflib
+import errno
 import json
 import os
+import re
+import shlex
 import shutil
 import subprocess
 import sys
+import tempfile
 from dataclasses import asdict, dataclass
 from datetime import datetime, timezone
 from pathlib import Path
@@ -14,18 +18,28 @@ from pathlib import Path
 from rich.console import Console
 
 from . import __version__
-from .errors import NotJJRepoError, NotRootWorkspaceError, WorkspaceExistsError
-from .jj import JJClient
+from .errors import (
+    InvalidAgentNameError,
+    NoGitRemoteError,
+    NotJJRepoError,
+    NotRootWorkspaceError,
+    PushRejectedError,
+    WorkspaceExistsError,
+)
+from .jj import JJClient, Workspace
 
 SHIM_DIR = ".jj/.kekkai-bin"
 AGENT_MARKER_FILE = ".jj/kekkai-agent"
 
-SHIM_CONTENT = """\
+SHIM_TEMPLATE = """\
 #!/bin/sh
-echo "git disabled for agents; use jj" >&2
+echo "{command} disabled for agents; use jj" >&2
 exit 1
 """
 
+# Commands shadowed by a blocking shim in agent workspaces
+SHIM_COMMANDS: tuple[str, ...] = ("git", "gh")
+
 
 @dataclass(frozen=True)
 class Agent:
@@ -33,14 +47,26 @@ class Agent:
 
     name: str
     executable: str
+    # Arguments that continue the most recent session in the current directory
+    resume_args: tuple[str, ...] = ()
 
 
 AGENTS: dict[str, Agent] = {
-    "codex": Agent("codex", "codex"),
-    "claude": Agent("claude", "claude"),
+    "codex": Agent("codex", "codex", ("resume", "--last")),
+    "claude": Agent("claude", "claude", ("--continue",)),
 }
 DEFAULT_AGENT = "codex"
 
+PORCELAIN_HELP = (
+    "Stable output for scripts: one line per agent with tab-separated "
+    "name, agent, git (blocked|allowed), change id, commit id and summary; "
+    "nothing is printed when there are no agents"
+)
+
+# Names that are subcommands or have special meaning to jj
+RESERVED_AGENT_NAMES = frozenset({"default", "list", "look", "diff", "push"})
+AGENT_NAME_RE = re.compile(r"^[A-Za-z0-9][A-Za-z0-9._-]*$")
+
 
 @dataclass
 class AgentMarker:
@@ -52,6 +78,82 @@ class AgentMarker:
     agent: str = "claude"  # default for backward compatibility
 
 
+@dataclass
+class AgentWorkspace:
+    """A tracked jj workspace identified as a kekkai agent by its marker."""
+
+    name: str
+    agent: str
+    path: str
+    workspace: Workspace
+
+
+def canonical_path(path: str) -> str:
+    """Normalize a path for comparisons (resolves symlinks like macOS /var).
+
+    Case is preserved: realpath does not fold it, even on case-insensitive
+    filesystems. Agent name collisions that differ only by case are caught
+    separately (see is_case_insensitive_fs).
+    """
+    return os.path.realpath(path)
+
+
+def read_agent_marker(workspace_path: str) -> dict | None:
+    """Return the parsed agent marker, or None if missing or unreadable."""
+    marker_path = Path(workspace_path) / AGENT_MARKER_FILE
+    try:
+        data = json.loads(marker_path.read_text())
+    except (json.JSONDecodeError, OSError):
+        return None
+    return data if isinstance(data, dict) else None
+
+
+def find_git_repo(start: str | None = None) -> Path | None:
+    """Return the nearest directory at or above start containing .git."""
+    path = Path(canonical_path(start or os.getcwd()))
+    for candidate in (path, *path.parents):
+        if (candidate / ".git").exists():
+            return candidate
+    return None
+
+
+def not_jj_repo_message(cwd: str | None = None) -> str:
+    """Explain a missing jj repo, with setup guidance for plain git repos."""
+    git_repo = find_git_repo(cwd)
+    if git_repo is None:
+        return "not in a jj repository"
+    return (
+        f"not in a jj repository, but {git_repo} is a git repository; "
+        "run 'jj git init --colocate' there (or 'kekkai --init') to use kekkai"
+    )
+
+
+def init_colocated(client: JJClient) -> None:
+    """Offer to initialize jj in the enclosing git repository."""
+    git_repo = find_git_repo()
+    if git_repo is None:
+        print("Error: --init requires a git repository", file=sys.stderr)
+        sys.exit(1)
+    if (git_repo / ".jj").exists():
+        print(f"{git_repo} is already a jj repository")
+        return
+
+    try:
+        answer = input(f"Run 'jj git init --colocate' in {git_repo}? [y/N] ")
+    except (EOFError, KeyboardInterrupt):
+        answer = ""
+    if answer.strip().lower() not in ("y", "yes"):
+        print("Aborted")
+        sys.exit(1)
+
+    try:
+        client.git_init_colocate(cwd=str(git_repo))
+    except Exception as e:
+        print(f"Error initializing jj: {e}", file=sys.stderr)
+        sys.exit(1)
+    print(f"Initialized colocated jj repository in {git_repo}")
+
+
 def find_root_workspace(client: JJClient) -> str:
     """Find the original root workspace.
 
@@ -59,15 +161,10 @@ def find_root_workspace(client: JJClient) -> str:
     Otherwise, returns the current jj workspace root.
     """
     current_root = client.workspace_root()
-    marker_path = Path(current_root) / AGENT_MARKER_FILE
+    data = read_agent_marker(current_root)
 
-    if marker_path.exists():
-        try:
-            data = json.loads(marker_path.read_text())
-            if root := data.get("root_workspace"):
-                return root
-        except (json.JSONDecodeError, OSError):
-            pass
+    if data and (root := data.get("root_workspace")):
+        return root
 
     return current_root
 
@@ -79,6 +176,36 @@ def ensure_root_workspace(root: str) -> None:
         raise NotRootWorkspaceError("look must be run from the root workspace")
 
 
+def validate_agent_name(name: str) -> None:
+    """Reject agent names that are reserved or unsafe as paths and revsets."""
+    if name.lower() in RESERVED_AGENT_NAMES:
+        raise InvalidAgentNameError(f"'{name}' is a reserved name")
+    if not AGENT_NAME_RE.match(name):
+        raise InvalidAgentNameError(
+            f"'{name}' must start with a letter or digit and contain only "
+            "letters, digits, '.', '_' or '-'"
+        )
+
+
+def is_case_insensitive_fs(directory: str) -> bool:
+    """Probe whether the filesystem holding directory ignores filename case."""
+    with tempfile.NamedTemporaryFile(dir=directory, prefix=".kekkai-case-") as f:
+        path = Path(f.name)
+        return (path.parent / path.name.upper()).exists()
+
+
+def find_name_collision(
+    name: str, existing: list[str], case_insensitive: bool
+) -> str | None:
+    """Return the existing agent name that name would collide with, if any."""
+    for candidate in existing:
+        if candidate == name:
+            return candidate
+        if case_insensitive and candidate.casefold() == name.casefold():
+            return candidate
+    return None
+
+
 def suggest_agent_names(query: str, candidates: list[str]) -> list[str]:
     """Return a short list of suggested agent names."""
     if not candidates:
@@ -104,6 +231,56 @@ def compute_jj_workspace_name(root_path: str, agent_name: str) -> str:
     return f"{Path(root_path).name}-{agent_name}"
 
 
+def discover_agent_workspaces(client: JJClient, root: str) -> list[AgentWorkspace]:
+    """Return the agent workspaces belonging to root.
+
+    jj's workspace list decides which workspaces are tracked; the marker
+    decides whether one is a kekkai agent and what it is called. A marker
+    that names another root or another agent (e.g. copied along with a
+    directory) is ignored. A marker that can't be read is still listed,
+    named from the workspace and with agent "unknown".
+    """
+    prefix = f"{Path(root).name}-"
+    agents = []
+    for ws in client.workspace_list(cwd=root):
+        if ws.name == "default":
+            continue
+
+        agent_path = Path(root).parent / ws.name
+        if not (agent_path / AGENT_MARKER_FILE).exists():
+            continue
+
+        data = read_agent_marker(str(agent_path)) or {}
+        name = data.get("name")
+        marker_root = data.get("root_workspace")
+        if not name or not marker_root:
+            # Unreadable or corrupt marker: nothing to check identity against
+            if ws.name.startswith(prefix):
+                agents.append(
+                    AgentWorkspace(
+                        name=ws.name[len(prefix) :],
+                        agent="unknown",
+                        path=str(agent_path),
+                        workspace=ws,
+                    )
+                )
+            continue
+        if canonical_path(marker_root) != canonical_path(root):
+            continue
+        if ws.name != compute_jj_workspace_name(root, name):
+            continue
+
+        agents.append(
+            AgentWorkspace(
+                name=name,
+                agent=data.get("agent", "claude"),
+                path=str(agent_path),
+                workspace=ws,
+            )
+        )
+    return agents
+
+
 def create_agent_marker(
     workspace_path: str, root_path: str, name: str, agent: str
 ) -> None:
@@ -119,22 +296,68 @@ def create_agent_marker(
 
 
 def check_parent_writable(root_path: str) -> None:
-    """Verify we can write to the parent directory."""
+    """Verify we can write to the parent directory.
+
+    Uses a uniquely named temp file so concurrent invocations don't collide.
+    """
     parent = Path(root_path).parent
-    test_file = parent / ".kekkai-write-test"
 
     try:
-        test_file.write_text("test")
-        test_file.unlink()
+        with tempfile.NamedTemporaryFile(dir=parent, prefix=".kekkai-write-test-"):
+            pass
     except OSError as e:
-        raise PermissionError(f"parent directory {parent} is not writable: {e}")
+        if e.errno == errno.EROFS:
+            reason = "is on a read-only filesystem"
+        elif e.errno in (errno.EACCES, errno.EPERM):
+            reason = "is not writable (permission denied)"
+        else:
+            reason = "is not writable"
+        raise PermissionError(f"parent directory {parent} {reason}: {e}") from e
+
+
+def create_shims(
+    shim_path: Path, commands: tuple[str, ...] = SHIM_COMMANDS
+) -> None:
+    """Write one blocking shim script per command into the shim directory."""
+    shim_path.mkdir(parents=True, exist_ok=True)
+    for command in commands:
+        shim_script = shim_path / command
+        shim_script.write_text(SHIM_TEMPLATE.format(command=command))
+        shim_script.chmod(0o755)
+
+
+def build_agent_env(shim_path: Path, allow_git: bool = False) -> dict[str, str]:
+    """Build the agent environment, blocking git unless it is allowed.
+
+    The shim directory is prepended to PATH and also used as GIT_EXEC_PATH,
+    so git run by absolute path can't reach its helpers (https transport,
+    git-lfs and other git-<command> programs). Builtin commands run that way
+    still work; no environment variable can stop them.
+    """
+    env = os.environ.copy()
+    if not allow_git:
+        env["PATH"] = f"{shim_path}:{env.get('PATH', '')}"
+        env["GIT_EXEC_PATH"] = str(shim_path)
+    return env
+
+
+def is_git_blocked(workspace_path: str) -> bool:
+    """Return whether the workspace has a git shim installed."""
+    return (Path(workspace_path) / SHIM_DIR / "git").exists()
+
+
+def resume_hint(agent: Agent, workspace_path: str) -> str | None:
+    """Return a shell command that continues the agent's session, if supported."""
+    if not agent.resume_args:
+        return None
+    command = shlex.join([agent.executable, *agent.resume_args])
+    return f"cd {shlex.quote(workspace_path)} && {command}"
 
 
 def has_uncommitted_changes(client: JJClient, workspace_path: str) -> bool:
     """Check if workspace has uncommitted changes."""
     try:
-        output = client.status(cwd=workspace_path)
-        return "Working copy changes:" in output
+        return client.working_copy_status(cwd=workspace_path).is_dirty
     except Exception:
         return False
 
@@ -145,22 +368,36 @@ def cleanup(
     """Clean up workspace resources."""
     ws_path = Path(workspace_path)
 
-    # Remove .git directory first so jj can work properly
+    # Record the agent's change (snapshotting any last edits) so it can be
+    # checked once the workspace no longer owns it
+    try:
+        change = client.change_id(cwd=workspace_path)
+    except Exception:
+        change = None
+
+    # Forget workspace in jj
+    try:
+        client.workspace_forget(jj_workspace_name, cwd=root_path)
+    except Exception as e:
+        print(f"Warning: failed to forget workspace: {e}", file=sys.stderr)
+
+    # Remove .git directory
     git_dir = ws_path / ".git"
     if git_dir.exists():
         shutil.rmtree(git_dir)
 
+    # Drop the orphaned change if the agent never edited or described it
+    if change:
+        try:
+            client.abandon_empty(change, cwd=root_path)
+        except Exception:
+            pass  # Non-fatal; jj may already have dropped it on forget
+
     # Remove marker file
     marker = ws_path / AGENT_MARKER_FILE
     if marker.exists():
         marker.unlink()
 
-    # Forget workspace in jj
-    try:
-        client.workspace_forget(jj_workspace_name, cwd=root_path)
-    except Exception as e:
-        print(f"Warning: failed to forget workspace: {e}", file=sys.stderr)
-
     # Remove directory
     try:
         shutil.rmtree(workspace_path)
@@ -168,17 +405,31 @@ def cleanup(
         print(f"Warning: failed to remove workspace directory: {e}", file=sys.stderr)
 
 
-def run_agent(name: str, agent: Agent) -> None:
+def run_agent(name: str, agent: Agent, allow_git: bool = False) -> None:
     """Create workspace and run agent."""
     client = JJClient()
     console = Console()
 
+    try:
+        validate_agent_name(name)
+    except InvalidAgentNameError as e:
+        console.print(f"Error: invalid agent name: {e}", style="red")
+        sys.exit(1)
+
+    if shutil.which(agent.executable) is None:
+        console.print(
+            f"Error: {agent.executable} not found on PATH; "
+            f"install {agent.name} and retry",
+            style="red",
+        )
+        sys.exit(1)
+
     with console.status("Summoning...", spinner="dots"):
         # 1. Find root workspace
         try:
             root = find_root_workspace(client)
         except NotJJRepoError:
-            console.print("Error: not in a jj repository", style="red")
+            console.print(f"Error: {not_jj_repo_message()}", style="red")
             sys.exit(1)
 
         # 2. Check parent directory is writable
@@ -193,6 +444,22 @@ def run_agent(name: str, agent: Agent) -> None:
         shim_path = Path(workspace_path) / SHIM_DIR
         jj_workspace_name = compute_jj_workspace_name(root, name)
 
+        # 3b. Catch names that only differ by case from an existing agent
+        #     (e.g. on macOS APFS), where the directories would collide
+        try:
+            case_insensitive = is_case_insensitive_fs(str(Path(root).parent))
+            existing = [a.name for a in discover_agent_workspaces(client, root)]
+        except Exception:
+            case_insensitive, existing = False, []
+        collision = find_name_collision(name, existing, case_insensitive)
+        if collision is not None:
+            message = f"Error: workspace '{name}' already exists"
+            if collision != name:
+                message += f" as '{collision}'"
+            console.print(message, style="red")
+            console.print("Use 'kekkai list' to see existing workspaces")
+            sys.exit(1)
+
         # 4. Create workspace via jj workspace add
         try:
             client.workspace_add(workspace_path, cwd=root)
@@ -238,20 +505,17 @@ def run_agent(name: str, agent: Agent) -> None:
             cleanup(client, jj_workspace_name, workspace_path, root)
             sys.exit(1)
 
-        # 9. Create git shim
-        try:
-            shim_path.mkdir(parents=True, exist_ok=True)
-            shim_script = shim_path / "git"
-            shim_script.write_text(SHIM_CONTENT)
-            shim_script.chmod(0o755)
-        except OSError as e:
-            console.print(f"Error creating git shim: {e}", style="red")
-            cleanup(client, jj_workspace_name, workspace_path, root)
-            sys.exit(1)
+        # 9. Create VCS shims (skipped with --allow-git)
+        if not allow_git:
+            try:
+                create_shims(shim_path)
+            except OSError as e:
+                console.print(f"Error creating shims: {e}", style="red")
+                cleanup(client, jj_workspace_name, workspace_path, root)
+                sys.exit(1)
 
         # 10. Build env with shim in PATH
-        env = os.environ.copy()
-        env["PATH"] = f"{shim_path}:{env.get('PATH', '')}"
+        env = build_agent_env(shim_path, allow_git)
 
     # 11. Run agent with terminal passthrough (outside spinner)
     result = subprocess.run([agent.executable], cwd=workspace_path, env=env)
@@ -260,14 +524,19 @@ def run_agent(name: str, agent: Agent) -> None:
         print(f"\n{agent.name.capitalize()} exited with code {result.returncode}", file=sys.stderr)
 
     # 11. Check for uncommitted changes
-    if has_uncommitted_changes(client, workspace_path):
+    dirty = has_uncommitted_changes(client, workspace_path)
+    if dirty:
         print("\nWarning: This workspace has uncommitted changes!")
 
-    # 12. Prompt for cleanup
-    try:
-        answer = input("\nKeep workspace for inspection? [y/N] ").strip().lower()
-    except (EOFError, KeyboardInterrupt):
-        answer = ""
+    # 12. Prompt for cleanup; without a TTY, keep dirty workspaces so no work
+    #     is lost and remove clean ones
+    if sys.stdin.isatty():
+        try:
+            answer = input("\nKeep workspace for inspection? [y/N] ").strip().lower()
+        except (EOFError, KeyboardInterrupt):
+            answer = ""
+    else:
+        answer = "y" if dirty else ""
 
     # 13. Cleanup or keep
     if answer not in ("y", "yes"):
@@ -275,53 +544,62 @@ def run_agent(name: str, agent: Agent) -> None:
         print(f"Workspace '{name}' removed")
     else:
         print(f"Workspace kept at: {workspace_path}")
+        if hint := resume_hint(agent, workspace_path):
+            print(f"Resume with: {hint}")
+
 
+def list_workspaces(porcelain: bool = False) -> None:
+    """List existing agent workspaces.
 
-def list_workspaces() -> None:
-    """List existing agent workspaces."""
+    With porcelain, prints one tab-separated line per agent (see PORCELAIN_HELP).
+    """
     client = JJClient()
 
     try:
         root = find_root_workspace(client)
     except NotJJRepoError:
-        print("Error: not in a jj repository", file=sys.stderr)
+        print(f"Error: {not_jj_repo_message()}", file=sys.stderr)
         sys.exit(1)
 
     try:
-        workspaces = client.workspace_list(cwd=root)
+        agents = discover_agent_workspaces(client, root)
     except Exception as e:
         print(f"Error listing workspaces: {e}", file=sys.stderr)
         sys.exit(1)
 
-    repo_name = Path(root).name
-    prefix = f"{repo_name}-"
-
-    found = False
-    for ws in workspaces:
-        # Skip default workspace
-        if ws.name == "default":
+    for agent in agents:
+        ws = agent.workspace
+        git_blocked = is_git_blocked(agent.path)
+        if porcelain:
+            git = "blocked" if git_blocked else "allowed"
+            fields = [agent.name, agent.agent, git, ws.change_id, ws.commit_id]
+            print("\t".join([*fields, ws.summary]))
             continue
+        tags = agent.agent if git_blocked else f"{agent.agent}, git allowed"
+        print(f"{agent.name} [{tags}]: {ws.change_id} {ws.commit_id} {ws.summary}")
 
-        # Check if this is a kekkai agent workspace
-        if ws.name.startswith(prefix):
-            agent_name = ws.name[len(prefix) :]
-
-            # Verify it has the agent marker
-            agent_path = Path(root).parent / ws.name
-            marker_path = agent_path / AGENT_MARKER_FILE
-            if marker_path.exists():
-                try:
-                    data = json.loads(marker_path.read_text())
-                    agent_type = data.get("agent", "claude")
-                except (json.JSONDecodeError, OSError):
-                    agent_type = "unknown"
-                print(f"{agent_name} [{agent_type}]: {ws.change_id} {ws.commit_id} {ws.summary}")
-                found = True
-
-    if not found:
+    if not agents and not porcelain:
         print("No workspaces")
 
 
+def resolve_agent(client: JJClient, root: str, agent_name: str) -> AgentWorkspace:
+    """Return the named agent workspace, or exit with suggestions if unknown."""
+    try:
+        agents = {a.name: a for a in discover_agent_workspaces(client, root)}
+    except Exception as e:
+        print(f"Error listing workspaces: {e}", file=sys.stderr)
+        sys.exit(1)
+
+    if agent_name not in agents:
+        print(f"Error: agent workspace '{agent_name}' not found", file=sys.stderr)
+        suggestions = suggest_agent_names(agent_name, sorted(agents.keys()))
+        if suggestions:
+            print(f"Did you mean: {', '.join(suggestions)}", file=sys.stderr)
+        sys.exit(1)
+
+    return agents[agent_name]
+
+
 def look_workspace(agent_name: str) -> None:
     """Create a new revision based on an agent workspace."""
     client = JJClient()
@@ -329,7 +607,7 @@ def look_workspace(agent_name: str) -> None:
     try:
         root = client.workspace_root()
     except NotJJRepoError:
-        print("Error: not in a jj repository", file=sys.stderr)
+        print(f"Error: {not_jj_repo_message()}", file=sys.stderr)
         sys.exit(1)
 
     try:
@@ -338,41 +616,98 @@ def look_workspace(agent_name: str) -> None:
         print(f"Error: {e}", file=sys.stderr)
         sys.exit(1)
 
+    agent = resolve_agent(client, root, agent_name)
+
     try:
-        workspaces = client.workspace_list(cwd=root)
+        client.new(revision=f"\"{agent.workspace.name}\"@", cwd=root)
     except Exception as e:
-        print(f"Error listing workspaces: {e}", file=sys.stderr)
+        print(f"Error creating new revision: {e}", file=sys.stderr)
         sys.exit(1)
 
-    repo_name = Path(root).name
-    prefix = f"{repo_name}-"
-    agents: dict[str, str] = {}
+    print(f"Created new revision from '{agent_name}'")
 
-    for ws in workspaces:
-        if ws.name == "default":
-            continue
-        if not ws.name.startswith(prefix):
-            continue
-        agent = ws.name[len(prefix) :]
-        agent_path = Path(root).parent / ws.name
-        marker_path = agent_path / AGENT_MARKER_FILE
-        if marker_path.exists():
-            agents[agent] = ws.name
 
-    if agent_name not in agents:
-        print(f"Error: agent workspace '{agent_name}' not found", file=sys.stderr)
-        suggestions = suggest_agent_names(agent_name, sorted(agents.keys()))
-        if suggestions:
-            print(f"Did you mean: {', '.join(suggestions)}", file=sys.stderr)
+def diff_workspace(
+    agent_name: str, stat: bool = False, tool: str | None = None
+) -> None:
+    """Write an agent workspace's working-copy diff to stdout."""
+    client = JJClient()
+
+    try:
+        root = find_root_workspace(client)
+    except NotJJRepoError:
+        print(f"Error: {not_jj_repo_message()}", file=sys.stderr)
         sys.exit(1)
 
+    agent = resolve_agent(client, root, agent_name)
+
+    # Snapshot the agent's working copy so the diff includes unsaved edits
+    try:
+        client.status(cwd=agent.path)
+    except Exception:
+        pass  # Non-fatal; fall back to the last snapshot
+
+    # Stream lines as jj produces them so large diffs aren't held in memory
+    lines = client.diff(
+        revision=f"\"{agent.workspace.name}\"@",
+        tool=tool,
+        stat=stat,
+        color=sys.stdout.isatty(),
+        cwd=root,
+    )
     try:
-        client.new(revision=f"\"{agents[agent_name]}\"@", cwd=root)
+        for line in lines:
+            print(line, flush=True)
+    except BrokenPipeError:
+        # The reader went away (e.g. piped into head): stop jj and point
+        # stdout at devnull so the flush at exit doesn't fail again
+        lines.close()
+        devnull = os.open(os.devnull, os.O_WRONLY)
+        os.dup2(devnull, sys.stdout.fileno())
+        sys.exit(1)
     except Exception as e:
-        print(f"Error creating new revision: {e}", file=sys.stderr)
+        print(f"Error getting diff: {e}", file=sys.stderr)
         sys.exit(1)
 
-    print(f"Created new revision from '{agent_name}'")
+
+def push_workspace(agent_name: str, remote: str | None = None) -> None:
+    """Push an agent workspace's change to a git remote under a new bookmark."""
+    client = JJClient()
+
+    try:
+        root = find_root_workspace(client)
+    except NotJJRepoError:
+        print(f"Error: {not_jj_repo_message()}", file=sys.stderr)
+        sys.exit(1)
+
+    agent = resolve_agent(client, root, agent_name)
+
+    # Snapshot the agent's working copy so unsaved edits are pushed too
+    try:
+        client.status(cwd=agent.path)
+    except Exception:
+        pass  # Non-fatal; fall back to the last snapshot
+
+    try:
+        output = client.push_change(
+            f"\"{agent.workspace.name}\"@", remote=remote, cwd=root
+        )
+    except NoGitRemoteError:
+        print(
+            "Error: no git remote to push to; add one with 'jj git remote add'",
+            file=sys.stderr,
+        )
+        sys.exit(1)
+    except PushRejectedError as e:
+        print(f"Error: the remote rejected the push: {e}", file=sys.stderr)
+        sys.exit(1)
+    except Exception as e:
+        print(f"Error pushing workspace: {e}", file=sys.stderr)
+        sys.exit(1)
+
+    if output.strip():
+        print(output.strip())
+    print(f"Pushed '{agent_name}'")
 
 
 def main() -> None:
@@ -390,12 +725,12 @@ def main() -> None:
     parser.add_argument(
         "name",
         nargs="?",
-        help="Workspace name (or 'list'/'look' commands)",
+        help="Workspace name (or 'list'/'look'/'diff'/'push' commands)",
     )
     parser.add_argument(
         "agent_name",
         nargs="?",
-        help="Agent workspace name for 'look'",
+        help="Agent workspace name for 'look'/'diff'/'push'",
     )
     parser.add_argument(
         "--agent",
@@ -404,20 +739,63 @@ def main() -> None:
         default=DEFAULT_AGENT,
         help=f"Agent to use (default: {DEFAULT_AGENT})",
     )
+    parser.add_argument(
+        "--allow-git",
+        action="store_true",
+        help="Do not block git (or gh) inside the agent workspace",
+    )
+    parser.add_argument(
+        "--porcelain",
+        action="store_true",
+        help=f"With 'list': {PORCELAIN_HELP}",
+    )
+    parser.add_argument(
+        "--stat",
+        action="store_true",
+        help="With 'diff': show a per-file summary instead of the full diff",
+    )
+    parser.add_argument(
+        "--tool",
+        help="With 'diff': render the diff through this external diff tool",
+    )
+    parser.add_argument(
+        "--remote",
+        help="With 'push': git remote to push to (default: jj's git.push setting)",
+    )
+    parser.add_argument(
+        "--init",
+        action="store_true",
+        help="Initialize jj in the current git repository (after confirmation)",
+    )
     args = parser.parse_args()
 
+    if args.init:
+        init_colocated(JJClient())
+        if args.name is None:
+            return
+
     if args.name is None:
         parser.print_help()
         sys.exit(1)
     elif args.name == "list":
-        list_workspaces()
+        list_workspaces(porcelain=args.porcelain)
     elif args.name == "look":
         if not args.agent_name:
             print("Error: look requires an agent name", file=sys.stderr)
             sys.exit(1)
         look_workspace(args.agent_name)
+    elif args.name == "diff":
+        if not args.agent_name:
+            print("Error: diff requires an agent name", file=sys.stderr)
+            sys.exit(1)
+        diff_workspace(args.agent_name, stat=args.stat, tool=args.tool)
+    elif args.name == "push":
+        if not args.agent_name:
+            print("Error: push requires an agent name", file=sys.stderr)
+            sys.exit(1)
+        push_workspace(args.agent_name, remote=args.remote)
     else:
-        run_agent(args.name, AGENTS[args.agent])
+        run_agent(args.name, AGENTS[args.agent], allow_git=args.allow_git)
 
 
 if __name__ == "__main__":
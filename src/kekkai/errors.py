@@ -25,12 +25,30 @@ class WorkspaceNotFoundError(KekkaiError):
     pass
 
 
+class InvalidAgentNameError(KekkaiError):
+    """Agent name is reserved or malformed."""
+
+    pass
+
+
 class NotRootWorkspaceError(KekkaiError):
     """Command requires the root workspace."""
 
     pass
 
 
+class NoGitRemoteError(KekkaiError):
+    """Repository has no git remote to push to."""
+
+    pass
+
+
+class PushRejectedError(KekkaiError):
+    """The git remote rejected a push."""
+
+    pass
+
+
 class JJCommandError(KekkaiError):
     """jj command failed."""
 
@@ -1,13 +1,18 @@
 """jj CLI wrapper."""
 
+import os
 import re
 import subprocess
+import tempfile
+from collections.abc import Iterator
 from dataclasses import dataclass
 
 from .errors import (
     JJCommandError,
     KekkaiError,
+    NoGitRemoteError,
     NotJJRepoError,
+    PushRejectedError,
     WorkspaceExistsError,
     WorkspaceNotFoundError,
 )
@@ -23,6 +28,62 @@ class Workspace:
     summary: str
 
 
+@dataclass
+class Commit:
+    """A commit as reported by jj log."""
+
+    change_id: str
+    commit_id: str
+    empty: bool
+    conflict: bool
+    description: str
+
+
+@dataclass
+class FileChange:
+    """A single path changed in the working copy."""
+
+    kind: str  # M, A, D, R or C as printed by jj
+    path: str
+
+
+@dataclass
+class Status:
+    """Parsed working copy status."""
+
+    changes: list[FileChange]
+
+    @property
+    def is_dirty(self) -> bool:
+        """Whether the working copy has any file changes."""
+        return bool(self.changes)
+
+
+# Parses change lines like: M src/main.py  /  R {old => new}.txt
+STATUS_CHANGE_RE = re.compile(r"^([MADRC]) (.+)$")
+
+
+def parse_status(output: str) -> Status:
+    """Parse `jj status` output into its file changes.
+
+    Only the per-file change lines are used, so the result does not depend
+    on the wording of jj's summary lines.
+    """
+    changes = []
+    for line in output.splitlines():
+        match = STATUS_CHANGE_RE.match(line)
+        if match:
+            changes.append(FileChange(kind=match.group(1), path=match.group(2)))
+    return Status(changes=changes)
+
+
+# Fields are separated by a raw unit separator so descriptions can't split them
+LOG_TEMPLATE = (
+    'change_id ++ "\x1f" ++ commit_id ++ "\x1f"'
+    ' ++ if(empty, "1", "0") ++ "\x1f" ++ if(conflict, "1", "0") ++ "\x1f"'
+    ' ++ description.first_line() ++ "\\n"'
+)
+
 # Parses lines like: default: wpxqlmox f3c3a79d (no description set)
 WORKSPACE_LINE_RE = re.compile(r"^(\S+): (\S+) (\S+) (.*)$")
 
@@ -43,9 +104,13 @@ class JJClient:
 
     def __init__(self, jj_path: str = "jj"):
         self.jj_path = jj_path
+        # Workspace roots keyed by the directory they were resolved from
+        self._root_cache: dict[str, str] = {}
 
-    def _run(self, *args: str, cwd: str | None = None) -> str:
-        """Execute jj command and return stdout."""
+    def _exec(
+        self, *args: str, cwd: str | None = None
+    ) -> subprocess.CompletedProcess[str]:
+        """Execute jj command and return the completed process."""
         result = subprocess.run(
             [self.jj_path, *args],
             capture_output=True,
@@ -55,11 +120,44 @@ class JJClient:
         if result.returncode != 0:
             cmd = args[0] if args else ""
             raise _parse_error(cmd, result.stderr.strip(), result.returncode)
-        return result.stdout
+        return result
+
+    def _run(self, *args: str, cwd: str | None = None) -> str:
+        """Execute jj command and return stdout."""
+        return self._exec(*args, cwd=cwd).stdout
+
+    def _run_lines(self, *args: str, cwd: str | None = None) -> Iterator[str]:
+        """Execute jj command and yield stdout line by line as it is produced.
+
+        Use for commands with large output; errors are raised once the
+        output has been consumed.
+        """
+        # stderr goes to a file so a chatty command can't block on a full pipe
+        with tempfile.TemporaryFile(mode="w+") as stderr:
+            with subprocess.Popen(
+                [self.jj_path, *args],
+                stdout=subprocess.PIPE,
+                stderr=stderr,
+                text=True,
+                cwd=cwd,
+            ) as proc:
+                assert proc.stdout is not None
+                for line in proc.stdout:
+                    yield line.rstrip("\n")
+            if proc.returncode != 0:
+                stderr.seek(0)
+                cmd = args[0] if args else ""
+                raise _parse_error(cmd, stderr.read().strip(), proc.returncode)
 
     def workspace_root(self, cwd: str | None = None) -> str:
-        """Return the root directory of the current workspace."""
-        return self._run("workspace", "root", cwd=cwd).strip()
+        """Return the root directory of the current workspace.
+
+        Results are cached per directory.
+        """
+        key = os.path.abspath(cwd or os.getcwd())
+        if key not in self._root_cache:
+            self._root_cache[key] = self._run("workspace", "root", cwd=cwd).strip()
+        return self._root_cache[key]
 
     def workspace_add(
         self, path: str, revision: str = "", cwd: str | None = None
@@ -93,10 +191,101 @@ class JJClient:
                 )
         return workspaces
 
+    def log(self, revset: str = "@", cwd: str | None = None) -> list[Commit]:
+        """Return the commits in a revset with their empty/conflict flags."""
+        output = self._run(
+            "log", "--no-graph", "-r", revset, "-T", LOG_TEMPLATE, cwd=cwd
+        )
+        commits = []
+        for line in output.splitlines():
+            fields = line.split("\x1f")
+            if len(fields) != 5:
+                continue
+            change_id, commit_id, empty, conflict, description = fields
+            commits.append(
+                Commit(
+                    change_id=change_id,
+                    commit_id=commit_id,
+                    empty=empty == "1",
+                    conflict=conflict == "1",
+                    description=description,
+                )
+            )
+        return commits
+
+    def abandon_empty(self, revision: str = "@", cwd: str | None = None) -> bool:
+        """Abandon a revision only if it has no changes and no description.
+
+        Returns True if the revision was blank and has been abandoned.
+        """
+        commits = self.log(revision, cwd=cwd)
+        if len(commits) != 1 or not commits[0].empty or commits[0].description:
+            return False
+        self._run("abandon", commits[0].change_id, cwd=cwd)
+        return True
+
+    def git_init_colocate(self, cwd: str | None = None) -> None:
+        """Initialize a jj repo colocated with the existing git repo in cwd."""
+        self._run("git", "init", "--colocate", cwd=cwd)
+
+    def push_change(
+        self, revision: str, remote: str | None = None, cwd: str | None = None
+    ) -> str:
+        """Push a change to a git remote, creating a bookmark for it.
+
+        Wraps `jj git push --change`. Returns jj's progress output.
+        Raises NoGitRemoteError or PushRejectedError for those failures.
+        """
+        args = ["git", "push", "--change", revision]
+        if remote:
+            args.extend(["--remote", remote])
+        try:
+            return self._exec(*args, cwd=cwd).stderr
+        except JJCommandError as e:
+            if "No git remote" in e.stderr:
+                raise NoGitRemoteError(e.stderr) from e
+            if "rejected" in e.stderr.lower():
+                raise PushRejectedError(e.stderr) from e
+            raise
+
     def status(self, cwd: str | None = None) -> str:
         """Return jj status output."""
         return self._run("status", cwd=cwd)
 
+    def working_copy_status(self, cwd: str | None = None) -> Status:
+        """Return the parsed status of the working copy."""
+        return parse_status(self.status(cwd=cwd))
+
+    def diff(
+        self,
+        revision: str = "@",
+        tool: str | None = None,
+        stat: bool = False,
+        color: bool = False,
+        cwd: str | None = None,
+    ) -> Iterator[str]:
+        """Yield the diff of a revision line by line as jj produces it.
+
+        With tool set, jj renders the diff through that external diff tool
+        (`jj diff --tool <name>`); otherwise the raw output is suitable for
+        piping to $PAGER. stat yields the per-file summary instead, and
+        color forces ANSI colors even though stdout is captured.
+        """
+        args = ["diff", "-r", revision]
+        if tool:
+            args.extend(["--tool", tool])
+        if stat:
+            args.append("--stat")
+        if color:
+            args.extend(["--color", "always"])
+        return self._run_lines(*args, cwd=cwd)
+
     def new(self, revision: str, cwd: str | None = None) -> str:
         """Create a new revision based on the given revision."""
         return self._run("new", "-r", revision, cwd=cwd)
+
+    def change_id(self, revision: str = "@", cwd: str | None = None) -> str:
+        """Return the change id of a single revision (defaults to the working copy)."""
+        return self._run(
+            "log", "--no-graph", "-r", revision, "-T", "change_id", cwd=cwd
+        ).strip()
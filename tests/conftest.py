@@ -6,6 +6,8 @@ from pathlib import Path
 
 import pytest
 
+from kekkai.jj import JJClient
+
 
 @pytest.fixture
 def temp_jj_repo(tmp_path):
@@ -21,9 +23,61 @@ def temp_jj_repo(tmp_path):
     return repo_dir
 
 
+@pytest.fixture
+def temp_colocated_repo(tmp_path):
+    """Create a temporary colocated jj + git repository."""
+    repo_dir = tmp_path / "colocated"
+    repo_dir.mkdir()
+
+    subprocess.run(
+        ["jj", "git", "init", "--colocate"],
+        cwd=repo_dir,
+        check=True,
+        capture_output=True,
+    )
+
+    return repo_dir
+
+
+@pytest.fixture
+def temp_git_repo(tmp_path):
+    """Create a temporary plain git repository (no jj)."""
+    repo_dir = tmp_path / "gitonly"
+    repo_dir.mkdir()
+
+    subprocess.run(["git", "init"], cwd=repo_dir, check=True, capture_output=True)
+
+    return repo_dir
+
+
 @pytest.fixture
 def temp_non_jj_dir(tmp_path):
     """Create a temporary directory that is NOT a jj repo."""
     non_jj_dir = tmp_path / "notjj"
     non_jj_dir.mkdir()
     return non_jj_dir
+
+
+@pytest.fixture
+def fake_jj(tmp_path):
+    """Return a factory for a JJClient backed by a scripted fake jj.
+
+    The fake records its arguments in tmp_path/"args", prints the given
+    stdout and stderr, and exits with returncode.
+    """
+
+    def make(stdout: str = "", stderr: str = "", returncode: int = 0) -> JJClient:
+        (tmp_path / "stdout").write_text(stdout)
+        (tmp_path / "stderr").write_text(stderr)
+        script = tmp_path / "jj"
+        script.write_text(
+            "#!/bin/sh\n"
+            f'echo "$@" > "{tmp_path}/args"\n'
+            f'cat "{tmp_path}/stdout"\n'
+            f'cat "{tmp_path}/stderr" >&2\n'
+            f"exit {returncode}\n"
+        )
+        script.chmod(0o755)
+        return JJClient(jj_path=str(script))
+
+    return make
@@ -1,7 +1,9 @@
 """Tests for kekkai.cli module."""
 
+import errno
 import json
 import os
+import shutil
 import subprocess
 import sys
 from pathlib import Path
@@ -14,16 +16,29 @@ from kekkai.cli import (
     SHIM_DIR,
     Agent,
     AgentMarker,
+    build_agent_env,
+    canonical_path,
     check_parent_writable,
     cleanup,
     compute_agent_path,
     compute_jj_workspace_name,
     create_agent_marker,
+    create_shims,
+    diff_workspace,
+    discover_agent_workspaces,
+    find_git_repo,
+    find_name_collision,
     find_root_workspace,
+    is_case_insensitive_fs,
+    is_git_blocked,
+    list_workspaces,
     look_workspace,
     main,
+    resume_hint,
     run_agent,
+    validate_agent_name,
 )
+from kekkai.errors import InvalidAgentNameError, NoGitRemoteError, PushRejectedError
 from kekkai.jj import JJClient
 
 
@@ -39,6 +54,128 @@ def test_compute_agent_path():
         assert compute_agent_path(root, name) == expected
 
 
+@pytest.mark.parametrize(
+    "name",
+    [
+        "default",
+        "list",
+        "look",
+        "diff",
+        "push",
+        "Look",
+        "",
+        "-rf",
+        ".x",
+        "a/b",
+        'x"y',
+        "a b",
+    ],
+)
+def test_validate_agent_name_rejects(name):
+    """Reserved and unsafe names should be rejected."""
+    with pytest.raises(InvalidAgentNameError):
+        validate_agent_name(name)
+
+
+@pytest.mark.parametrize("name", ["feature-auth", "agent1", "fix_login", "v1.2"])
+def test_validate_agent_name_accepts(name):
+    """Ordinary names should be accepted."""
+    validate_agent_name(name)
+
+
+def test_run_agent_rejects_reserved_name(temp_jj_repo, monkeypatch, capsys):
+    """run_agent should refuse reserved names before creating a workspace."""
+    monkeypatch.chdir(temp_jj_repo)
+
+    with pytest.raises(SystemExit) as excinfo:
+        run_agent("default", AGENTS["claude"])
+
+    assert excinfo.value.code == 1
+    assert not Path(compute_agent_path(str(temp_jj_repo), "default")).exists()
+
+
+def test_run_agent_missing_executable(temp_jj_repo, monkeypatch, capsys):
+    """A missing agent binary should fail clearly before creating a workspace."""
+    missing = Agent("missing", "kekkai-no-such-agent")
+    monkeypatch.chdir(temp_jj_repo)
+
+    with pytest.raises(SystemExit) as excinfo:
+        run_agent("missing-bin", missing)
+
+    assert excinfo.value.code == 1
+    assert "kekkai-no-such-agent not found on PATH" in capsys.readouterr().out
+    assert not Path(compute_agent_path(str(temp_jj_repo), "missing-bin")).exists()
+
+
+def test_find_name_collision():
+    """Collisions ignore case only on case-insensitive filesystems."""
+    existing = ["fix-auth", "other"]
+
+    assert find_name_collision("fix-auth", existing, False) == "fix-auth"
+    assert find_name_collision("Fix-Auth", existing, False) is None
+    assert find_name_collision("Fix-Auth", existing, True) == "fix-auth"
+    assert find_name_collision("new", existing, True) is None
+
+
+def test_is_case_insensitive_fs(tmp_path):
+    """The probe should agree with the filesystem and clean up after itself."""
+    (tmp_path / "probe").write_text("x")
+    expected = (tmp_path / "PROBE").exists()
+
+    assert is_case_insensitive_fs(str(tmp_path)) == expected
+    assert sorted(p.name for p in tmp_path.iterdir()) == ["probe"]
+
+
+def test_run_agent_rejects_case_collision(temp_jj_repo, monkeypatch, capsys):
+    """Names differing only by case collide on case-insensitive filesystems."""
+    client = JJClient()
+    agent_path = compute_agent_path(str(temp_jj_repo), "fix-auth")
+    client.workspace_add(agent_path, cwd=str(temp_jj_repo))
+    create_agent_marker(agent_path, str(temp_jj_repo), "fix-auth", "claude")
+
+    monkeypatch.setattr("kekkai.cli.is_case_insensitive_fs", lambda _: True)
+    monkeypatch.setattr("kekkai.cli.shutil.which", lambda _: "/bin/true")
+    monkeypatch.chdir(temp_jj_repo)
+
+    with pytest.raises(SystemExit) as excinfo:
+        run_agent("Fix-Auth", AGENTS["claude"])
+
+    assert excinfo.value.code == 1
+    assert "already exists as 'fix-auth'" in capsys.readouterr().out
+
+
+def test_run_agent_exact_name_collision(temp_jj_repo, monkeypatch, capsys):
+    """An exact name match keeps the plain "already exists" message."""
+    client = JJClient()
+    agent_path = compute_agent_path(str(temp_jj_repo), "fix-auth")
+    client.workspace_add(agent_path, cwd=str(temp_jj_repo))
+    create_agent_marker(agent_path, str(temp_jj_repo), "fix-auth", "claude")
+
+    monkeypatch.setattr("kekkai.cli.shutil.which", lambda _: "/bin/true")
+    monkeypatch.chdir(temp_jj_repo)
+
+    with pytest.raises(SystemExit) as excinfo:
+        run_agent("fix-auth", AGENTS["claude"])
+
+    assert excinfo.value.code == 1
+    out = capsys.readouterr().out
+    assert "workspace 'fix-auth' already exists" in out
+    assert " as '" not in out
+
+
+def test_resume_hint():
+    """Agents with resume support get a copy-pasteable command."""
+    assert (
+        resume_hint(AGENTS["claude"], "/tmp/repo-a")
+        == "cd /tmp/repo-a && claude --continue"
+    )
+    assert (
+        resume_hint(AGENTS["codex"], "/tmp/my repo-a")
+        == "cd '/tmp/my repo-a' && codex resume --last"
+    )
+    assert resume_hint(Agent("other", "other"), "/tmp/repo-a") is None
+
+
 def test_compute_jj_workspace_name():
     """Test jj workspace name computation."""
     cases = [
@@ -124,13 +261,9 @@ def test_git_shim_creation(temp_jj_repo):
     client.workspace_add(agent_path, cwd=str(temp_jj_repo))
 
     # Create git shim
-    from kekkai.cli import SHIM_CONTENT
-
     shim_path = Path(agent_path) / SHIM_DIR
-    shim_path.mkdir(parents=True, exist_ok=True)
+    create_shims(shim_path)
     shim_script = shim_path / "git"
-    shim_script.write_text(SHIM_CONTENT)
-    shim_script.chmod(0o755)
 
     # Verify shim exists and is executable
     assert shim_script.exists()
@@ -144,6 +277,71 @@ def test_git_shim_creation(temp_jj_repo):
     assert "git disabled" in result.stderr
 
 
+def test_create_shims_blocks_each_command(tmp_path):
+    """Each configured command should get an executable shim that blocks it."""
+    shim_path = tmp_path / SHIM_DIR
+
+    create_shims(shim_path, ("git", "gh", "git-lfs"))
+
+    for command in ("git", "gh", "git-lfs"):
+        shim_script = shim_path / command
+        assert os.access(shim_script, os.X_OK)
+        result = subprocess.run(
+            [str(shim_script), "status"], capture_output=True, text=True
+        )
+        assert result.returncode != 0
+        assert f"{command} disabled" in result.stderr
+
+
+def test_build_agent_env_blocks_git_by_default(tmp_path, monkeypatch):
+    """The shim directory should be prepended to PATH by default."""
+    monkeypatch.setenv("PATH", "/usr/bin")
+    shim_path = tmp_path / SHIM_DIR
+
+    env = build_agent_env(shim_path)
+
+    assert env["PATH"] == f"{shim_path}:/usr/bin"
+    assert env["GIT_EXEC_PATH"] == str(shim_path)
+
+
+def test_build_agent_env_guards_absolute_git(tmp_path):
+    """git run by absolute path should look for its helpers in the shim dir."""
+    git = shutil.which("git")
+    shim_path = tmp_path / SHIM_DIR
+    create_shims(shim_path)
+
+    result = subprocess.run(
+        [git, "--exec-path"],
+        env=build_agent_env(shim_path),
+        capture_output=True,
+        text=True,
+    )
+
+    assert result.stdout.strip() == str(shim_path)
+
+
+def test_build_agent_env_allow_git(tmp_path, monkeypatch):
+    """With allow_git, PATH and git's exec path should be left untouched."""
+    monkeypatch.setenv("PATH", "/usr/bin")
+    monkeypatch.delenv("GIT_EXEC_PATH", raising=False)
+    shim_path = tmp_path / SHIM_DIR
+
+    env = build_agent_env(shim_path, allow_git=True)
+
+    assert env["PATH"] == "/usr/bin"
+    assert "GIT_EXEC_PATH" not in env
+
+
+def test_is_git_blocked(tmp_path):
+    """is_git_blocked should reflect whether the shim exists."""
+    workspace = tmp_path / "ws"
+    workspace.mkdir()
+    assert not is_git_blocked(str(workspace))
+
+    create_shims(workspace / SHIM_DIR)
+    assert is_git_blocked(str(workspace))
+
+
 def test_git_dir_creation(temp_jj_repo):
     """Test .git directory creation."""
     client = JJClient()
@@ -181,12 +379,8 @@ def test_cleanup(temp_jj_repo):
     git_dir = Path(agent_path) / ".git"
     git_dir.mkdir(parents=True, exist_ok=True)
 
-    # Create shim
-    from kekkai.cli import SHIM_CONTENT
-
-    shim_path = Path(agent_path) / SHIM_DIR
-    shim_path.mkdir(parents=True, exist_ok=True)
-    (shim_path / "git").write_text(SHIM_CONTENT)
+    # Create shims
+    create_shims(Path(agent_path) / SHIM_DIR)
 
     # Verify workspace exists
     assert Path(agent_path).exists()
@@ -203,12 +397,120 @@ def test_cleanup(temp_jj_repo):
     assert jj_workspace_name not in names
 
 
+def test_cleanup_abandons_only_empty_changes(temp_jj_repo):
+    """After cleanup an idle agent's change is gone but real work survives."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+
+    changes = {}
+    for agent_name in ("idle", "busy"):
+        agent_path = compute_agent_path(root, agent_name)
+        client.workspace_add(agent_path, cwd=root)
+        create_agent_marker(agent_path, root, agent_name, "claude")
+        (Path(agent_path) / ".git").mkdir()
+        changes[agent_name] = client.change_id(cwd=agent_path)
+    (Path(compute_agent_path(root, "busy")) / "work.txt").write_text("work\n")
+
+    for agent_name in ("idle", "busy"):
+        cleanup(
+            client,
+            compute_jj_workspace_name(root, agent_name),
+            compute_agent_path(root, agent_name),
+            root,
+        )
+
+    visible = subprocess.run(
+        ["jj", "log", "--no-graph", "-r", "all()", "-T", 'change_id ++ "\\n"'],
+        cwd=root,
+        check=True,
+        capture_output=True,
+        text=True,
+    ).stdout.split()
+    assert changes["idle"] not in visible
+    assert changes["busy"] in visible
+
+
+def test_cleanup_keeps_described_empty_change(temp_jj_repo):
+    """A change with a description but no edits is not abandoned on cleanup."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+
+    agent_path = compute_agent_path(root, "planner")
+    client.workspace_add(agent_path, cwd=root)
+    create_agent_marker(agent_path, root, "planner", "claude")
+    subprocess.run(
+        ["jj", "describe", "-m", "plan the refactor"],
+        cwd=agent_path,
+        check=True,
+        capture_output=True,
+    )
+    change = client.change_id(cwd=agent_path)
+
+    cleanup(client, compute_jj_workspace_name(root, "planner"), agent_path, root)
+
+    commits = client.log(change, cwd=root)
+    assert len(commits) == 1
+    assert commits[0].empty
+    assert commits[0].description == "plan the refactor"
+
+
+def test_cleanup_generic_forget_failure(tmp_path, fake_jj, capsys):
+    """A failed forget is reported but does not stop cleanup."""
+    client = fake_jj(stderr="Error: Failed to lock working copy", returncode=1)
+
+    root = tmp_path / "repo"
+    root.mkdir()
+    agent_path = Path(compute_agent_path(str(root), "locked"))
+    (agent_path / ".jj").mkdir(parents=True)
+
+    cleanup(client, "repo-locked", str(agent_path), str(root))
+
+    err = capsys.readouterr().err
+    assert "failed to forget workspace" in err
+    assert not agent_path.exists()
+
+
 def test_check_parent_writable(temp_jj_repo):
     """Test parent directory writability check."""
     # Parent should be writable (it's a temp dir)
     check_parent_writable(str(temp_jj_repo))  # Should not raise
 
 
+def test_check_parent_writable_concurrent(tmp_path):
+    """Concurrent checks should not collide or leave litter behind."""
+    from concurrent.futures import ThreadPoolExecutor
+
+    root = tmp_path / "repo"
+    root.mkdir()
+
+    with ThreadPoolExecutor(max_workers=8) as pool:
+        list(pool.map(lambda _: check_parent_writable(str(root)), range(32)))
+
+    assert sorted(p.name for p in tmp_path.iterdir()) == ["repo"]
+
+
+@pytest.mark.parametrize(
+    ("err", "expected"),
+    [
+        (errno.EROFS, "read-only filesystem"),
+        (errno.EACCES, "permission denied"),
+    ],
+)
+def test_check_parent_writable_error_reason(tmp_path, monkeypatch, err, expected):
+    """The error message should say why the parent is not writable."""
+
+    def fail(*args, **kwargs):
+        raise OSError(err, os.strerror(err))
+
+    monkeypatch.setattr("kekkai.cli.tempfile.NamedTemporaryFile", fail)
+
+    with pytest.raises(PermissionError) as excinfo:
+        check_parent_writable(str(tmp_path / "repo"))
+
+    assert expected in str(excinfo.value)
+    assert excinfo.value.__cause__.errno == err
+
+
 def test_markers_hidden_from_jj_status(temp_jj_repo):
     """Test that markers don't appear in jj status."""
     client = JJClient()
@@ -233,6 +535,40 @@ def test_markers_hidden_from_jj_status(temp_jj_repo):
     assert "kekkai-agent" not in status
 
 
+def test_spawned_agents_share_base(temp_jj_repo, monkeypatch, capsys):
+    """Successive agents should branch from the same base, not chain."""
+    mock_bin = temp_jj_repo.parent / "mock-bin"
+    mock_bin.mkdir()
+    mock_claude = mock_bin / "claude"
+    mock_claude.write_text("#!/bin/sh\necho work > agent.txt\nexit 0\n")
+    mock_claude.chmod(0o755)
+    monkeypatch.setenv("PATH", f"{mock_bin}:{os.environ.get('PATH', '')}")
+
+    # Keep both workspaces at the cleanup prompt
+    monkeypatch.setattr("sys.stdin.isatty", lambda: True)
+    monkeypatch.setattr("builtins.input", lambda _: "y")
+
+    client = JJClient()
+    root = str(temp_jj_repo)
+    base = client.change_id("@-", cwd=root)
+
+    monkeypatch.chdir(temp_jj_repo)
+    run_agent("first", AGENTS["claude"])
+    first_path = compute_agent_path(root, "first")
+
+    # Spawn the second agent from inside the first one
+    monkeypatch.chdir(first_path)
+    run_agent("second", AGENTS["claude"])
+    second_path = compute_agent_path(root, "second")
+
+    assert "Resume with: cd " in capsys.readouterr().out
+
+    first_change = client.change_id(cwd=first_path)
+    assert client.change_id("@-", cwd=first_path) == base
+    assert client.change_id("@-", cwd=second_path) == base
+    assert client.change_id("@-", cwd=second_path) != first_change
+
+
 def test_nested_agent_creation(temp_jj_repo):
     """Test creating agent from within another agent workspace."""
     client = JJClient()
@@ -453,3 +789,414 @@ def test_look_workspace_suggests_similar_names(temp_jj_repo, monkeypatch, capsys
     err = capsys.readouterr().err.lower()
     assert "did you mean" in err
     assert agent_name in err
+
+
+def test_discover_agent_workspaces_uses_marker_identity(temp_jj_repo):
+    """Only workspaces whose marker names them and this root are agents."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+
+    agent_path = compute_agent_path(root, "real")
+    client.workspace_add(agent_path, cwd=root)
+    create_agent_marker(agent_path, root, "real", "claude")
+
+    # Workspace from other tooling whose name collides with the repo prefix
+    ci_path = compute_agent_path(root, "ci")
+    client.workspace_add(ci_path, cwd=root)
+
+    # Directory copied from an agent, carrying a stale marker
+    copy_path = compute_agent_path(root, "copy")
+    client.workspace_add(copy_path, cwd=root)
+    create_agent_marker(copy_path, root, "real", "claude")
+
+    agents = discover_agent_workspaces(client, root)
+
+    assert [a.name for a in agents] == ["real"]
+    assert agents[0].agent == "claude"
+    assert agents[0].path == agent_path
+
+
+def test_discover_agent_workspaces_corrupt_marker(temp_jj_repo):
+    """Workspaces with an unparseable marker are listed as unknown agents."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+
+    agent_path = compute_agent_path(root, "broken")
+    client.workspace_add(agent_path, cwd=root)
+    (Path(agent_path) / AGENT_MARKER_FILE).write_text("{not json")
+
+    partial_path = compute_agent_path(root, "partial")
+    client.workspace_add(partial_path, cwd=root)
+    (Path(partial_path) / AGENT_MARKER_FILE).write_text('{"agent": "codex"}')
+
+    agents = discover_agent_workspaces(client, root)
+
+    assert sorted((a.name, a.agent) for a in agents) == [
+        ("broken", "unknown"),
+        ("partial", "unknown"),
+    ]
+    assert {a.path for a in agents} == {agent_path, partial_path}
+
+
+def test_canonical_path_resolves_symlinks(tmp_path):
+    """Symlinked and real paths to the same directory should compare equal."""
+    real = tmp_path / "real"
+    real.mkdir()
+    link = tmp_path / "link"
+    link.symlink_to(real)
+
+    assert canonical_path(str(link)) == canonical_path(str(real))
+    assert canonical_path(str(link / ".." / "real")) == canonical_path(str(real))
+    assert canonical_path(str(tmp_path / "other")) != canonical_path(str(real))
+
+
+def test_discover_agent_workspaces_symlinked_root(temp_jj_repo, tmp_path):
+    """A marker recording the root through a symlink should still match."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+    link = tmp_path / "repo-link"
+    link.symlink_to(temp_jj_repo)
+
+    agent_path = compute_agent_path(root, "linked")
+    client.workspace_add(agent_path, cwd=root)
+    create_agent_marker(agent_path, str(link), "linked", "claude")
+
+    agents = discover_agent_workspaces(client, root)
+
+    assert [a.name for a in agents] == ["linked"]
+
+
+def test_list_workspaces_ignores_foreign_root(
+    temp_jj_repo, tmp_path, monkeypatch, capsys
+):
+    """A marker pointing at another root should not be listed."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+
+    agent_path = compute_agent_path(root, "other")
+    client.workspace_add(agent_path, cwd=root)
+    create_agent_marker(agent_path, str(tmp_path / "elsewhere"), "other", "codex")
+
+    monkeypatch.chdir(temp_jj_repo)
+    list_workspaces()
+
+    assert capsys.readouterr().out.strip() == "No workspaces"
+
+
+def test_list_workspaces_porcelain(temp_jj_repo, monkeypatch, capsys):
+    """Porcelain output should be tab-separated with fixed columns."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+
+    blocked_path = compute_agent_path(root, "blocked")
+    client.workspace_add(blocked_path, cwd=root)
+    create_agent_marker(blocked_path, root, "blocked", "claude")
+    create_shims(Path(blocked_path) / SHIM_DIR)
+
+    allowed_path = compute_agent_path(root, "allowed")
+    client.workspace_add(allowed_path, cwd=root)
+    create_agent_marker(allowed_path, root, "allowed", "codex")
+
+    monkeypatch.chdir(temp_jj_repo)
+    list_workspaces(porcelain=True)
+
+    lines = sorted(capsys.readouterr().out.splitlines())
+    assert len(lines) == 2
+    allowed, blocked = (line.split("\t") for line in lines)
+    assert allowed[:3] == ["allowed", "codex", "allowed"]
+    assert blocked[:3] == ["blocked", "claude", "blocked"]
+    assert all(len(fields) == 6 for fields in (allowed, blocked))
+
+
+def test_list_workspaces_porcelain_empty(temp_jj_repo, monkeypatch, capsys):
+    """Porcelain output should be empty when there are no agents."""
+    monkeypatch.chdir(temp_jj_repo)
+    list_workspaces(porcelain=True)
+
+    assert capsys.readouterr().out == ""
+
+
+def test_run_agent_non_interactive_skips_prompt(temp_jj_repo, monkeypatch):
+    """Without a TTY, run_agent must not prompt and removes a clean workspace."""
+    mock_bin = temp_jj_repo / "mock-bin"
+    mock_bin.mkdir()
+    mock_claude = mock_bin / "claude"
+    mock_claude.write_text("#!/bin/sh\nexit 0\n")
+    mock_claude.chmod(0o755)
+    monkeypatch.setenv("PATH", f"{mock_bin}:{os.environ.get('PATH', '')}")
+
+    def fail_input(_):
+        raise AssertionError("input() should not be called without a TTY")
+
+    monkeypatch.setattr("builtins.input", fail_input)
+    monkeypatch.setattr("sys.stdin.isatty", lambda: False)
+    monkeypatch.chdir(temp_jj_repo)
+
+    run_agent("ci-run", AGENTS["claude"])
+
+    assert not Path(compute_agent_path(str(temp_jj_repo), "ci-run")).exists()
+
+
+def test_run_agent_non_interactive_keeps_dirty_workspace(
+    temp_jj_repo, monkeypatch, capsys
+):
+    """Without a TTY, a workspace with uncommitted changes must be kept."""
+    mock_bin = temp_jj_repo.parent / "mock-bin"
+    mock_bin.mkdir()
+    mock_claude = mock_bin / "claude"
+    mock_claude.write_text("#!/bin/sh\necho work > agent.txt\nexit 0\n")
+    mock_claude.chmod(0o755)
+    monkeypatch.setenv("PATH", f"{mock_bin}:{os.environ.get('PATH', '')}")
+
+    def fail_input(_):
+        raise AssertionError("input() should not be called without a TTY")
+
+    monkeypatch.setattr("builtins.input", fail_input)
+    monkeypatch.setattr("sys.stdin.isatty", lambda: False)
+    monkeypatch.chdir(temp_jj_repo)
+
+    run_agent("ci-dirty", AGENTS["claude"])
+
+    agent_path = Path(compute_agent_path(str(temp_jj_repo), "ci-dirty"))
+    assert (agent_path / "agent.txt").read_text() == "work\n"
+    out = capsys.readouterr().out
+    assert "uncommitted changes" in out
+    assert f"Workspace kept at: {agent_path}" in out
+
+
+def test_not_jj_repo_suggests_colocate_in_git_repo(
+    temp_git_repo, monkeypatch, capsys
+):
+    """A plain git repo should get jj setup guidance instead of a bare error."""
+    subdir = temp_git_repo / "sub"
+    subdir.mkdir()
+    monkeypatch.chdir(subdir)
+
+    with pytest.raises(SystemExit) as excinfo:
+        list_workspaces()
+
+    assert excinfo.value.code == 1
+    err = capsys.readouterr().err
+    assert str(temp_git_repo.resolve()) in err
+    assert "jj git init --colocate" in err
+
+
+def test_not_jj_repo_plain_dir(temp_non_jj_dir, monkeypatch, capsys):
+    """Outside any repository the error stays short."""
+    monkeypatch.setattr("kekkai.cli.find_git_repo", lambda cwd=None: None)
+    monkeypatch.chdir(temp_non_jj_dir)
+
+    with pytest.raises(SystemExit):
+        list_workspaces()
+
+    assert capsys.readouterr().err.strip() == "Error: not in a jj repository"
+
+
+def test_find_git_repo(temp_git_repo, temp_colocated_repo):
+    """find_git_repo should find plain and colocated repositories."""
+    nested = temp_git_repo / "a" / "b"
+    nested.mkdir(parents=True)
+
+    assert find_git_repo(str(nested)) == temp_git_repo.resolve()
+    assert find_git_repo(str(temp_colocated_repo)) == temp_colocated_repo.resolve()
+
+
+def test_init_flag_colocates_git_repo(temp_git_repo, monkeypatch, capsys):
+    """--init should run jj git init --colocate after confirmation."""
+    monkeypatch.chdir(temp_git_repo)
+    monkeypatch.setattr("builtins.input", lambda _: "y")
+    monkeypatch.setattr(sys, "argv", ["kekkai", "--init"])
+
+    main()
+
+    assert (temp_git_repo / ".jj").is_dir()
+    assert "Initialized colocated jj repository" in capsys.readouterr().out
+
+
+def test_list_workspaces_colocated(temp_colocated_repo, monkeypatch, capsys):
+    """Colocated repos should work like plain jj repos."""
+    client = JJClient()
+    root = str(temp_colocated_repo)
+    agent_path = compute_agent_path(root, "colo")
+    client.workspace_add(agent_path, cwd=root)
+    create_agent_marker(agent_path, root, "colo", "claude")
+
+    monkeypatch.chdir(temp_colocated_repo)
+    list_workspaces()
+
+    assert capsys.readouterr().out.startswith("colo [claude")
+
+
+def test_diff_workspace(temp_jj_repo, monkeypatch, capsys):
+    """diff should print the agent's working-copy changes, or a stat summary."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+    agent_path = compute_agent_path(root, "differ")
+    client.workspace_add(agent_path, cwd=root)
+    create_agent_marker(agent_path, root, "differ", "claude")
+    (Path(agent_path) / "agent.txt").write_text("agent work\n")
+
+    monkeypatch.chdir(temp_jj_repo)
+
+    diff_workspace("differ")
+    out = capsys.readouterr().out
+    assert "agent.txt" in out
+    assert "agent work" in out
+    assert "\x1b[" not in out  # no color when stdout is not a TTY
+
+    diff_workspace("differ", stat=True)
+    out = capsys.readouterr().out
+    assert "agent.txt" in out
+    assert "1 file changed" in out
+
+
+def test_diff_command_passes_tool(temp_jj_repo, monkeypatch):
+    """diff --tool should hand the tool name through to jj diff."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+    agent_path = compute_agent_path(root, "differ")
+    client.workspace_add(agent_path, cwd=root)
+    create_agent_marker(agent_path, root, "differ", "claude")
+
+    calls = []
+
+    def fake_diff(self, revision="@", tool=None, stat=False, color=False, cwd=None):
+        calls.append((revision, tool, stat))
+        return iter([])
+
+    monkeypatch.setattr(JJClient, "diff", fake_diff)
+    monkeypatch.setattr(sys, "argv", ["kekkai", "diff", "differ", "--tool", "difft"])
+    monkeypatch.chdir(temp_jj_repo)
+
+    main()
+
+    assert calls == [('"testrepo-differ"@', "difft", False)]
+
+
+def test_diff_workspace_streams_output(temp_jj_repo, monkeypatch, capsys):
+    """Each diff line should reach stdout before jj produces the next one."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+    agent_path = compute_agent_path(root, "streamer")
+    client.workspace_add(agent_path, cwd=root)
+    create_agent_marker(agent_path, root, "streamer", "claude")
+
+    seen = []
+
+    def fake_diff(self, *args, **kwargs):
+        yield "first"
+        seen.append(capsys.readouterr().out)
+        yield "second"
+
+    monkeypatch.setattr(JJClient, "diff", fake_diff)
+    monkeypatch.chdir(temp_jj_repo)
+
+    diff_workspace("streamer")
+
+    assert seen == ["first\n"]
+    assert capsys.readouterr().out == "second\n"
+
+
+def test_diff_workspace_reader_closes_early(temp_jj_repo):
+    """Closing the pipe mid-diff should exit quietly, like git diff | head."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+    agent_path = compute_agent_path(root, "bulky")
+    client.workspace_add(agent_path, cwd=root)
+    create_agent_marker(agent_path, root, "bulky", "claude")
+    # Well past a pipe buffer, so jj is still writing when the reader leaves
+    big = "".join(f"line {i}\n" for i in range(50000))
+    (Path(agent_path) / "big.txt").write_text(big)
+
+    env = os.environ.copy()
+    src = str(Path(__file__).parent.parent / "src")
+    env["PYTHONPATH"] = os.pathsep.join(filter(None, [src, env.get("PYTHONPATH")]))
+    proc = subprocess.Popen(
+        [sys.executable, "-m", "kekkai", "diff", "bulky"],
+        cwd=root,
+        env=env,
+        stdout=subprocess.PIPE,
+        stderr=subprocess.PIPE,
+        text=True,
+    )
+    assert proc.stdout.readline()
+    proc.stdout.close()
+    stderr = proc.stderr.read()
+    proc.wait(timeout=30)
+
+    assert "Error getting diff" not in stderr
+    assert "Broken pipe" not in stderr
+    assert "Exception ignored" not in stderr
+
+
+def test_diff_workspace_unknown_agent(temp_jj_repo, monkeypatch, capsys):
+    """diff should fail with suggestions for unknown agents."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+    agent_path = compute_agent_path(root, "differ")
+    client.workspace_add(agent_path, cwd=root)
+    create_agent_marker(agent_path, root, "differ", "claude")
+
+    monkeypatch.chdir(temp_jj_repo)
+    with pytest.raises(SystemExit) as excinfo:
+        diff_workspace("difer")
+
+    assert excinfo.value.code == 1
+    assert "did you mean: differ" in capsys.readouterr().err.lower()
+
+
+def test_push_command_pushes_agent_change(temp_jj_repo, monkeypatch, capsys):
+    """push should push the agent's working-copy change to the given remote."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+    agent_path = compute_agent_path(root, "pusher")
+    client.workspace_add(agent_path, cwd=root)
+    create_agent_marker(agent_path, root, "pusher", "claude")
+
+    calls = []
+
+    def fake_push(self, revision, remote=None, cwd=None):
+        calls.append((revision, remote))
+        return "Creating bookmark push-abc\n"
+
+    monkeypatch.setattr(JJClient, "push_change", fake_push)
+    monkeypatch.setattr(sys, "argv", ["kekkai", "push", "pusher", "--remote", "up"])
+    monkeypatch.chdir(temp_jj_repo)
+
+    main()
+
+    assert calls == [('"testrepo-pusher"@', "up")]
+    out = capsys.readouterr().out
+    assert "push-abc" in out
+    assert "Pushed 'pusher'" in out
+
+
+@pytest.mark.parametrize(
+    ("error", "expected"),
+    [
+        (NoGitRemoteError("No git remote named 'origin'"), "no git remote"),
+        (PushRejectedError("rejected"), "rejected the push"),
+    ],
+)
+def test_push_command_reports_errors(
+    temp_jj_repo, monkeypatch, capsys, error, expected
+):
+    """push should turn typed push failures into clear messages."""
+    client = JJClient()
+    root = str(temp_jj_repo)
+    agent_path = compute_agent_path(root, "pusher")
+    client.workspace_add(agent_path, cwd=root)
+    create_agent_marker(agent_path, root, "pusher", "claude")
+
+    def fake_push(self, revision, remote=None, cwd=None):
+        raise error
+
+    monkeypatch.setattr(JJClient, "push_change", fake_push)
+    monkeypatch.setattr(sys, "argv", ["kekkai", "push", "pusher"])
+    monkeypatch.chdir(temp_jj_repo)
+
+    with pytest.raises(SystemExit) as excinfo:
+        main()
+
+    assert excinfo.value.code == 1
+    assert expected in capsys.readouterr().err
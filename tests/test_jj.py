@@ -6,8 +6,13 @@ from pathlib import Path
 
 import pytest
 
-from kekkai.errors import NotJJRepoError, WorkspaceExistsError
-from kekkai.jj import JJClient
+from kekkai.errors import (
+    NoGitRemoteError,
+    NotJJRepoError,
+    PushRejectedError,
+    WorkspaceExistsError,
+)
+from kekkai.jj import FileChange, JJClient, parse_status
 
 
 def test_workspace_root(temp_jj_repo):
@@ -22,6 +27,25 @@ def test_workspace_root(temp_jj_repo):
     assert actual == expected
 
 
+def test_workspace_root_cached(tmp_path, monkeypatch):
+    """workspace_root should only shell out once per directory."""
+    client = JJClient()
+    calls = []
+
+    def fake_run(*args, cwd=None):
+        calls.append((args, cwd))
+        return "/repo\n"
+
+    monkeypatch.setattr(client, "_run", fake_run)
+
+    assert client.workspace_root(cwd=str(tmp_path)) == "/repo"
+    assert client.workspace_root(cwd=str(tmp_path)) == "/repo"
+    assert len(calls) == 1
+
+    client.workspace_root(cwd=str(tmp_path / "other"))
+    assert len(calls) == 2
+
+
 def test_workspace_add(temp_jj_repo):
     """Test adding a workspace."""
     client = JJClient()
@@ -80,6 +104,177 @@ def test_workspace_forget(temp_jj_repo):
     assert workspace_path.exists()
 
 
+@pytest.mark.parametrize(
+    ("kwargs", "expected"),
+    [
+        ({}, "diff -r @"),
+        ({"revision": "abc"}, "diff -r abc"),
+        ({"tool": "difft"}, "diff -r @ --tool difft"),
+        ({"stat": True, "color": True}, "diff -r @ --stat --color always"),
+    ],
+)
+def test_diff_command(tmp_path, fake_jj, kwargs, expected):
+    """diff should pass the revision and optional tool through to jj."""
+    client = fake_jj()
+
+    list(client.diff(cwd=str(tmp_path), **kwargs))
+
+    assert (tmp_path / "args").read_text().strip() == expected
+
+
+def test_diff_shows_working_copy_changes(temp_jj_repo):
+    """diff should include files changed in the working copy."""
+    client = JJClient()
+    (temp_jj_repo / "hello.txt").write_text("hello\n")
+
+    output = "\n".join(client.diff(cwd=str(temp_jj_repo)))
+
+    assert "hello.txt" in output
+
+
+def test_log_flags_empty_change(temp_jj_repo):
+    """log should flag an empty working copy and clear the flag after edits."""
+    client = JJClient()
+    repo = str(temp_jj_repo)
+
+    [commit] = client.log(cwd=repo)
+    assert commit.empty
+    assert not commit.conflict
+    assert commit.change_id == client.change_id(cwd=repo)
+
+    (temp_jj_repo / "file.txt").write_text("content\n")
+    subprocess.run(
+        ["jj", "describe", "-m", "add file\n\nbody"],
+        cwd=repo,
+        check=True,
+        capture_output=True,
+    )
+
+    [commit] = client.log(cwd=repo)
+    assert not commit.empty
+    assert commit.description == "add file"
+
+
+def test_abandon_empty(temp_jj_repo):
+    """abandon_empty should only abandon changes without edits or a description."""
+    client = JJClient()
+    repo = str(temp_jj_repo)
+
+    (temp_jj_repo / "file.txt").write_text("content\n")
+    non_empty = client.change_id(cwd=repo)
+    assert client.abandon_empty(cwd=repo) is False
+    assert client.change_id(cwd=repo) == non_empty
+
+    client.new("@", cwd=repo)
+    subprocess.run(
+        ["jj", "describe", "-m", "planned"], cwd=repo, check=True, capture_output=True
+    )
+    described = client.change_id(cwd=repo)
+    assert client.abandon_empty(cwd=repo) is False
+    assert client.change_id(cwd=repo) == described
+
+    client.new("@", cwd=repo)
+    empty = client.change_id(cwd=repo)
+    assert client.abandon_empty(cwd=repo) is True
+    assert client.change_id(cwd=repo) != empty
+    assert client.change_id("@-", cwd=repo) == described
+
+
+def test_push_change_command(tmp_path, fake_jj):
+    """push_change should push the change with an optional remote."""
+    client = fake_jj(stderr="Creating bookmark push-abc")
+
+    output = client.push_change("abc", remote="upstream", cwd=str(tmp_path))
+
+    args = (tmp_path / "args").read_text().strip()
+    assert args == "git push --change abc --remote upstream"
+    assert "push-abc" in output
+
+
+@pytest.mark.parametrize(
+    ("stderr", "error"),
+    [
+        ("Error: No git remote named 'origin'", NoGitRemoteError),
+        ("Error: Failed to push some bookmarks: rejected", PushRejectedError),
+    ],
+)
+def test_push_change_errors(tmp_path, fake_jj, stderr, error):
+    """push_change should map common failures to typed errors."""
+    client = fake_jj(stderr=stderr, returncode=1)
+
+    with pytest.raises(error):
+        client.push_change("abc", cwd=str(tmp_path))
+
+
+@pytest.mark.parametrize(
+    ("output", "changes"),
+    [
+        (
+            "The working copy has no changes.\n"
+            "Working copy  (@) : qpvuntsm 230dd059 (empty) (no description set)\n"
+            "Parent commit (@-): zzzzzzzz 00000000 (empty) (no description set)\n",
+            [],
+        ),
+        (
+            "Working copy changes:\n"
+            "M src/main.py\n"
+            "A new file.txt\n"
+            "D gone.txt\n"
+            "Working copy  (@) : qpvuntsm 4b8e2b3a (no description set)\n",
+            [
+                FileChange("M", "src/main.py"),
+                FileChange("A", "new file.txt"),
+                FileChange("D", "gone.txt"),
+            ],
+        ),
+        (
+            "Des changements dans la copie de travail :\nR {a => b}.txt\n",
+            [FileChange("R", "{a => b}.txt")],
+        ),
+    ],
+)
+def test_parse_status(output, changes):
+    """parse_status should rely on change lines, not summary wording."""
+    status = parse_status(output)
+
+    assert status.changes == changes
+    assert status.is_dirty == bool(changes)
+
+
+def test_working_copy_status(temp_jj_repo):
+    """working_copy_status should flip to dirty after editing a file."""
+    client = JJClient()
+    repo = str(temp_jj_repo)
+
+    assert not client.working_copy_status(cwd=repo).is_dirty
+
+    (temp_jj_repo / "file.txt").write_text("content\n")
+    status = client.working_copy_status(cwd=repo)
+
+    assert status.is_dirty
+    assert status.changes == [FileChange("A", "file.txt")]
+
+
+def test_run_lines_streams_each_line(tmp_path, fake_jj):
+    """_run_lines should yield every line of the command's output."""
+    client = fake_jj(stdout="one\ntwo\n\nthree\n")
+
+    assert list(client._run_lines("log", cwd=str(tmp_path))) == [
+        "one",
+        "two",
+        "",
+        "three",
+    ]
+
+
+def test_run_lines_raises_after_output(tmp_path, fake_jj):
+    """_run_lines should raise a typed error when the command fails."""
+    client = fake_jj(stderr='Error: There is no jj repo in "."', returncode=1)
+
+    with pytest.raises(NotJJRepoError):
+        list(client._run_lines("log", cwd=str(tmp_path)))
+
+
 def test_new_revision(temp_jj_repo):
     """Test creating a new revision."""
     client = JJClient()
@@ -109,6 +304,21 @@ def test_new_revision(temp_jj_repo):
     assert before != after
 
 
+def test_change_id_follows_working_copy(temp_jj_repo):
+    """change_id should report the working copy change and move with jj new."""
+    client = JJClient()
+
+    before = client.change_id(cwd=str(temp_jj_repo))
+    assert before
+    assert client.change_id(cwd=str(temp_jj_repo)) == before
+
+    client.new("@", cwd=str(temp_jj_repo))
+    after = client.change_id(cwd=str(temp_jj_repo))
+
+    assert after != before
+    assert client.change_id("@-", cwd=str(temp_jj_repo)) == before
+
+
 def test_not_jj_repo(temp_non_jj_dir):
     """Test error when not in a jj repo."""
     client = JJClient()